@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// departmentPayload is the request body accepted by the department CRUD
+// endpoints.
+type departmentPayload struct {
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	ContactName string `json:"contact_name"`
+	Notes       string `json:"notes"`
+	URL         string `json:"url"`
+}
+
+func (s *foiaServer) createDepartmentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload departmentPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, fmt.Sprintf("unable to decode body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if payload.Name == "" || payload.Email == "" {
+		http.Error(w, "name and email are required", http.StatusBadRequest)
+		return
+	}
+
+	slug := slugify(payload.Name)
+	_, err := s.db.Exec(`INSERT INTO departments_base (
+		name,
+		name_slug,
+		email,
+		contact_name,
+		notes,
+		url
+	) VALUES (?, ?, ?, ?, ?, ?)`,
+		payload.Name, slug, payload.Email, payload.ContactName, payload.Notes, payload.URL)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to create department: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		NameSlug string `json:"name_slug"`
+	}{slug})
+}
+
+func (s *foiaServer) updateDepartmentHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "Missing department ID", http.StatusBadRequest)
+		return
+	}
+
+	var payload departmentPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, fmt.Sprintf("unable to decode body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if payload.Name == "" || payload.Email == "" {
+		http.Error(w, "name and email are required", http.StatusBadRequest)
+		return
+	}
+
+	res, err := s.db.Exec(`UPDATE departments_base SET
+		name = ?,
+		name_slug = ?,
+		email = ?,
+		contact_name = ?,
+		notes = ?,
+		url = ?
+		WHERE name_slug = ?`,
+		payload.Name, slugify(payload.Name), payload.Email, payload.ContactName, payload.Notes, payload.URL, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to update department: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Department not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *foiaServer) deleteDepartmentHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "Missing department ID", http.StatusBadRequest)
+		return
+	}
+
+	res, err := s.db.Exec(`DELETE FROM departments_base WHERE name_slug = ?`, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to delete department: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Department not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"tailscale.com/client/tailscale"
+	"tailscale.com/client/tailscale/apitype"
+)
+
+// User is the tailnet identity resolved for a request by adminAuth.
+type User struct {
+	LoginName   string `json:"login_name"`
+	DisplayName string `json:"display_name"`
+	Tailnet     string `json:"tailnet"`
+}
+
+type userContextKeyType struct{}
+
+var userContextKey userContextKeyType
+
+func userFromContext(ctx context.Context) (User, bool) {
+	u, ok := ctx.Value(userContextKey).(User)
+	return u, ok
+}
+
+// tsnetWhoIs is the subset of *tailscale.LocalClient that adminAuth depends
+// on, so it can resolve a caller's identity from tsnet.Server.LocalClient().
+type tsnetWhoIs interface {
+	WhoIs(ctx context.Context, remoteAddr string) (*apitype.WhoIsResponse, error)
+}
+
+var _ tsnetWhoIs = (*tailscale.LocalClient)(nil)
+
+// adminAuth gates the admin endpoints behind the caller's tailnet identity.
+// When whoIs is nil (not running under --tsnet) it fails closed unless
+// devAllowAnon is set.
+type adminAuth struct {
+	whoIs          tsnetWhoIs
+	allowedUsers   map[string]struct{}
+	allowedTailnet string
+	devAllowAnon   bool
+}
+
+func newAdminAuth(whoIs tsnetWhoIs, adminUsers, adminTailnet string, devAllowAnon bool) *adminAuth {
+	allowed := make(map[string]struct{})
+	for _, u := range strings.Split(adminUsers, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			allowed[u] = struct{}{}
+		}
+	}
+	return &adminAuth{
+		whoIs:          whoIs,
+		allowedUsers:   allowed,
+		allowedTailnet: adminTailnet,
+		devAllowAnon:   devAllowAnon,
+	}
+}
+
+// resolve returns the identity of the caller at remoteAddr. It returns an
+// error only when the identity itself can't be determined; whether that
+// identity is authorized is a separate question answered by allowed().
+func (a *adminAuth) resolve(ctx context.Context, remoteAddr string) (User, error) {
+	if a.whoIs == nil {
+		if a.devAllowAnon {
+			return User{LoginName: "dev-anon"}, nil
+		}
+		return User{}, fmt.Errorf("admin authorization requires --tsnet (or --dev-allow-anon for local dev)")
+	}
+
+	who, err := a.whoIs.WhoIs(ctx, remoteAddr)
+	if err != nil {
+		return User{}, fmt.Errorf("resolving tailnet identity: %w", err)
+	}
+	if who.UserProfile == nil {
+		return User{}, fmt.Errorf("no user profile for %s", remoteAddr)
+	}
+
+	user := User{
+		LoginName:   who.UserProfile.LoginName,
+		DisplayName: who.UserProfile.DisplayName,
+	}
+	if i := strings.LastIndex(user.LoginName, "@"); i >= 0 {
+		user.Tailnet = user.LoginName[i+1:]
+	}
+	return user, nil
+}
+
+// allowed reports whether user is permitted to use admin endpoints, per
+// --admin-users / --admin-tailnet / --dev-allow-anon.
+func (a *adminAuth) allowed(user User) bool {
+	if a.whoIs == nil && a.devAllowAnon {
+		return true
+	}
+	if _, ok := a.allowedUsers[user.LoginName]; ok {
+		return true
+	}
+	if a.allowedTailnet != "" && user.Tailnet == a.allowedTailnet {
+		return true
+	}
+	return false
+}
+
+// Middleware resolves the caller's tailnet identity and rejects the request
+// with a structured 403 unless it's authorized. On success it attaches the
+// resolved User to the request context and logs it.
+func (a *adminAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.resolve(r.Context(), r.RemoteAddr)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		if !a.allowed(user) {
+			writeAuthError(w, fmt.Errorf("%s is not an admin", user.LoginName))
+			return
+		}
+
+		logger.Info("admin request authorized",
+			slog.String("login_name", user.LoginName),
+			slog.String("request_id", requestIDFromContext(r.Context())),
+		)
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireIdentity resolves the caller's tailnet identity and rejects the
+// request with a structured 403 if it can't be determined, but — unlike
+// Middleware — does not consult the admin allow-list, so any identified
+// tailnet user may proceed. Used for endpoints scoped to the caller's own
+// data (e.g. polling the status of an email they just submitted) rather
+// than admin-only endpoints.
+func (a *adminAuth) RequireIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.resolve(r.Context(), r.RemoteAddr)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func writeAuthError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+// whoamiHandler lets operators debug admin ACLs by returning the identity
+// tsnet resolves for them and whether it currently passes adminAuth.allowed.
+func whoamiHandler(auth *adminAuth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := auth.resolve(r.Context(), r.RemoteAddr)
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			json.NewEncoder(w).Encode(struct {
+				Error string `json:"error"`
+			}{err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(struct {
+			User    User `json:"user"`
+			Allowed bool `json:"allowed"`
+		}{user, auth.allowed(user)})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// openDB opens (creating if necessary) the sqlite database at path and
+// brings its schema up to date via applyMigrations.
+func openDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	if err := applyMigrations(db); err != nil {
+		return nil, fmt.Errorf("applying migrations: %w", err)
+	}
+	return db, nil
+}
+
+// applyMigrations runs any embedded migrations/*.sql files that haven't yet
+// been recorded in schema_migrations, in filename order.
+func applyMigrations(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version TEXT PRIMARY KEY,
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	entries, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return fmt.Errorf("reading migrations: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		var applied int
+		if err := db.QueryRow(`SELECT count(*) FROM schema_migrations WHERE version = ?`, entry.Name()).Scan(&applied); err != nil {
+			return fmt.Errorf("checking migration %s: %w", entry.Name(), err)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		contents, err := migrationsFS.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return fmt.Errorf("reading migration %s: %w", entry.Name(), err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("beginning transaction for migration %s: %w", entry.Name(), err)
+		}
+		if _, err := tx.Exec(string(contents)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying migration %s: %w", entry.Name(), err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, entry.Name()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("recording migration %s: %w", entry.Name(), err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("committing migration %s: %w", entry.Name(), err)
+		}
+		logger.Info("applied migration", slog.String("version", entry.Name()))
+	}
+
+	return nil
+}
+
+// seedDepartments populates departments_base from the embedded
+// departments.json the first time the server runs against an empty
+// database. It is a no-op once any department rows exist.
+func seedDepartments(db *sql.DB, departments map[string]Department) error {
+	var count int
+	if err := db.QueryRow(`SELECT count(*) FROM departments_base`).Scan(&count); err != nil {
+		return fmt.Errorf("counting departments: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	for name, dept := range departments {
+		_, err := db.Exec(`INSERT INTO departments_base (
+			name,
+			name_slug,
+			email,
+			contact_name,
+			notes,
+			url
+		) VALUES (?, ?, ?, ?, ?, ?)`,
+			name,
+			slugify(name),
+			dept.Email,
+			dept.ContactName,
+			dept.Notes,
+			dept.URL,
+		)
+		if err != nil {
+			return fmt.Errorf("seeding department %q: %w", name, err)
+		}
+	}
+	logger.Info("seeded departments", slog.Int("count", len(departments)))
+	return nil
+}
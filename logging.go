@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// logger is the application-wide structured logger, configured from
+// --log-format and --log-level in main().
+var logger *slog.Logger
+
+type contextKey string
+
+const requestIDContextKey contextKey = "request_id"
+
+// requestIDFromContext returns the request ID attached by LoggingMiddleware,
+// or "" if none is present.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// newLogger builds the application logger for the given --log-format
+// (text|json) and --log-level (debug|info|warn|error), wrapping the
+// underlying handler in a dedupHandler to collapse repeated log spam.
+func newLogger(format, level string) *slog.Logger {
+	var lvl slog.Level
+	switch strings.ToLower(level) {
+	case "debug":
+		lvl = slog.LevelDebug
+	case "warn":
+		lvl = slog.LevelWarn
+	case "error":
+		lvl = slog.LevelError
+	default:
+		lvl = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+
+	return slog.New(newDedupHandler(handler, time.Second))
+}
+
+// tsnetLogf adapts logger to the func(string, ...any) signature expected by
+// tsnet.Server.Logf.
+func tsnetLogf(logger *slog.Logger) func(format string, args ...any) {
+	return func(format string, args ...any) {
+		logger.Info(fmt.Sprintf(format, args...))
+	}
+}
+
+// statusRecorder wraps an http.ResponseWriter to capture the status code and
+// byte count written, for access logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// LoggingMiddleware returns middleware that emits one structured access-log
+// record per request and ensures every request carries an X-Request-ID,
+// generating one if the caller didn't supply it. The ID is both returned in
+// the response header and attached to r.Context() so downstream handlers can
+// include it via slog.With(slog.String("request_id", requestIDFromContext(ctx))).
+func LoggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := r.Header.Get("X-Request-ID")
+			if requestID == "" {
+				requestID = uuid.NewString()
+			}
+			w.Header().Set("X-Request-ID", requestID)
+			r = r.WithContext(context.WithValue(r.Context(), requestIDContextKey, requestID))
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			logger.Info("http request",
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.Int("bytes", rec.bytes),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("user_agent", r.UserAgent()),
+				slog.String("referer", r.Referer()),
+				slog.String("request_id", requestID),
+			)
+		})
+	}
+}
+
+// dedupHandler wraps a slog.Handler and collapses consecutive identical
+// records (same level, message and attributes other than request_id; see
+// dedupKey) seen within window into a
+// single record carrying a repeated=N attribute, so a hot error loop (e.g. a
+// client repeatedly sending an unparsable FTS5 query) logs once per window
+// instead of flooding the output.
+type dedupHandler struct {
+	next   slog.Handler
+	window time.Duration
+
+	mu      sync.Mutex
+	pending *pendingRecord
+}
+
+type pendingRecord struct {
+	key    string
+	record slog.Record
+	count  int
+	timer  *time.Timer
+}
+
+func newDedupHandler(next slog.Handler, window time.Duration) *dedupHandler {
+	return &dedupHandler{next: next, window: window}
+}
+
+func (h *dedupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *dedupHandler) Handle(ctx context.Context, r slog.Record) error {
+	key := dedupKey(r)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.pending != nil && h.pending.key == key {
+		h.pending.count++
+		return nil
+	}
+
+	if h.pending != nil {
+		h.flushLocked()
+	}
+
+	p := &pendingRecord{key: key, record: r.Clone(), count: 1}
+	p.timer = time.AfterFunc(h.window, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.pending == p {
+			h.flushLocked()
+		}
+	})
+	h.pending = p
+	return nil
+}
+
+// flushLocked emits the pending record, tagging it with repeated=N if it was
+// seen more than once. Caller must hold h.mu.
+func (h *dedupHandler) flushLocked() {
+	p := h.pending
+	h.pending = nil
+	if p == nil {
+		return
+	}
+	p.timer.Stop()
+
+	rec := p.record
+	if p.count > 1 {
+		rec.AddAttrs(slog.Int("repeated", p.count))
+	}
+	h.next.Handle(context.Background(), rec)
+}
+
+// Close flushes any pending record immediately. It must be called before
+// process exit, since a record otherwise sits buffered until window elapses
+// and an exiting process never gives it that chance — without this, whatever
+// happens to be the last record logged (e.g. "servers successfully shut
+// down") is silently lost.
+func (h *dedupHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flushLocked()
+	return nil
+}
+
+func (h *dedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &dedupHandler{next: h.next.WithAttrs(attrs), window: h.window}
+}
+
+func (h *dedupHandler) WithGroup(name string) slog.Handler {
+	return &dedupHandler{next: h.next.WithGroup(name), window: h.window}
+}
+
+// dedupKey builds the key records are grouped by. It excludes request_id,
+// since LoggingMiddleware attaches a fresh one to every request; keying on
+// it would make the one record logged on every request unique every time,
+// defeating deduplication entirely.
+func dedupKey(r slog.Record) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d|%s", r.Level, r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "request_id" {
+			return true
+		}
+		fmt.Fprintf(&b, "|%s=%v", a.Key, a.Value)
+		return true
+	})
+	return b.String()
+}
@@ -0,0 +1,58 @@
+// Package mailer sends FOIA request emails over SMTP.
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// Config holds the SMTP transport settings used to send outbound mail.
+type Config struct {
+	Host string
+	Port int
+	User string
+	Pass string
+	From string
+}
+
+// Transport sends email via a single configured SMTP server.
+type Transport struct {
+	cfg Config
+}
+
+// NewTransport builds a Transport from cfg.
+func NewTransport(cfg Config) *Transport {
+	return &Transport{cfg: cfg}
+}
+
+// Send delivers a plain-text email to to with the given subject and body.
+func (t *Transport) Send(to, subject, body string) error {
+	addr := fmt.Sprintf("%s:%d", t.cfg.Host, t.cfg.Port)
+
+	var auth smtp.Auth
+	if t.cfg.User != "" {
+		auth = smtp.PlainAuth("", t.cfg.User, t.cfg.Pass, t.cfg.Host)
+	}
+
+	return smtp.SendMail(addr, auth, t.cfg.From, []string{to}, buildMessage(t.cfg.From, to, subject, body))
+}
+
+// buildMessage assembles the RFC 5322 message smtp.SendMail hands to the
+// server. net/smtp only CRLF-validates the envelope from/to, not the
+// message headers, so header values are stripped of CR/LF here to prevent
+// header injection from an untrusted subject or address.
+func buildMessage(from, to, subject, body string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", stripCRLF(from))
+	fmt.Fprintf(&b, "To: %s\r\n", stripCRLF(to))
+	fmt.Fprintf(&b, "Subject: %s\r\n", stripCRLF(subject))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	b.WriteString(body)
+	return b.Bytes()
+}
+
+func stripCRLF(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickod/sunshine/mailer"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxSendAttempts is how many send attempts, the first one included, the
+// worker makes before marking an outbox row permanently failed.
+const maxSendAttempts = 5
+
+const outboxBatchSize = 20
+
+var (
+	emailSentTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sunshine_email_sent_total",
+		Help: "Count of FOIA request emails successfully sent",
+	})
+	emailFailedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sunshine_email_failed_total",
+			Help: "Count of FOIA request email send failures",
+		},
+		[]string{"reason"},
+	)
+	emailSendDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "sunshine_email_send_duration_seconds",
+		Help: "Duration of outbound SMTP send attempts",
+	})
+	outboxQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sunshine_outbox_queue_depth",
+		Help: "Number of outbox rows still awaiting delivery",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(emailSentTotal)
+	prometheus.MustRegister(emailFailedTotal)
+	prometheus.MustRegister(emailSendDuration)
+	prometheus.MustRegister(outboxQueueDepth)
+}
+
+type outboxEntry struct {
+	ID             int64      `json:"id"`
+	DepartmentSlug string     `json:"department_slug"`
+	Submitter      string     `json:"-"`
+	To             string     `json:"to"`
+	Subject        string     `json:"subject"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	SentAt         *time.Time `json:"sent_at,omitempty"`
+}
+
+type sendDepartmentRequest struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// sendDepartmentHandler validates the request body, enqueues an outbox row
+// for the worker to pick up, and returns a tracking id the submitter can
+// poll via outboxHandler.
+func (s *foiaServer) sendDepartmentHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unable to resolve caller identity", http.StatusForbidden)
+		return
+	}
+
+	slug := r.PathValue("id")
+	if slug == "" {
+		http.Error(w, "Missing department ID", http.StatusBadRequest)
+		return
+	}
+
+	var deptEmail string
+	if err := s.db.QueryRow(`SELECT email FROM departments_base WHERE name_slug = ?`, slug).Scan(&deptEmail); err != nil {
+		http.Error(w, fmt.Sprintf("Department not found: %v", err), http.StatusNotFound)
+		return
+	}
+
+	var payload sendDepartmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, fmt.Sprintf("unable to decode body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if payload.Subject == "" || payload.Body == "" {
+		http.Error(w, "subject and body are required", http.StatusBadRequest)
+		return
+	}
+	if strings.ContainsAny(payload.Subject, "\r\n") {
+		http.Error(w, "subject must not contain line breaks", http.StatusBadRequest)
+		return
+	}
+
+	res, err := s.db.Exec(`INSERT INTO outbox (department_slug, submitter, "to", subject, body) VALUES (?, ?, ?, ?, ?)`,
+		slug, user.LoginName, deptEmail, payload.Subject, payload.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to enqueue email: %v", err), http.StatusInternalServerError)
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unable to enqueue email: %v", err), http.StatusInternalServerError)
+		return
+	}
+	outboxQueueDepth.Inc()
+
+	logger.Info("enqueued FOIA request email",
+		slog.Int64("outbox_id", id),
+		slog.String("department_slug", slug),
+		slog.String("request_id", requestIDFromContext(r.Context())),
+	)
+
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, struct {
+		ID int64 `json:"id"`
+	}{id})
+}
+
+// outboxHandler lets a submitter poll the delivery status of a previously
+// enqueued email. It only ever returns entries the caller submitted
+// themselves; entries belonging to other identities are reported as
+// not found so a guessed id can't be used to read someone else's outbox.
+func (s *foiaServer) outboxHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unable to resolve caller identity", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid outbox id", http.StatusBadRequest)
+		return
+	}
+
+	var entry outboxEntry
+	var sentAt sql.NullTime
+	row := s.db.QueryRow(`
+		SELECT id, department_slug, submitter, "to", subject, status, attempts, last_error, created_at, sent_at
+		FROM outbox WHERE id = ?`, id)
+	if err := row.Scan(&entry.ID, &entry.DepartmentSlug, &entry.Submitter, &entry.To, &entry.Subject, &entry.Status, &entry.Attempts, &entry.LastError, &entry.CreatedAt, &sentAt); err != nil {
+		http.Error(w, fmt.Sprintf("Outbox entry not found: %v", err), http.StatusNotFound)
+		return
+	}
+	if entry.Submitter != user.LoginName {
+		http.Error(w, "Outbox entry not found", http.StatusNotFound)
+		return
+	}
+	if sentAt.Valid {
+		entry.SentAt = &sentAt.Time
+	}
+
+	writeJSON(w, entry)
+}
+
+// runOutboxWorker polls the outbox on pollInterval and attempts delivery of
+// any due rows until ctx is cancelled. ctx only gates when the next poll
+// starts; a batch already in flight runs to completion so graceful shutdown
+// can drain it within the caller's shutdown window.
+func runOutboxWorker(ctx context.Context, db *sql.DB, transport *mailer.Transport, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			processOutboxBatch(db, transport)
+		}
+	}
+}
+
+type dueEmail struct {
+	id       int64
+	to       string
+	subject  string
+	body     string
+	attempts int
+}
+
+func processOutboxBatch(db *sql.DB, transport *mailer.Transport) {
+	rows, err := db.Query(`
+		SELECT id, "to", subject, body, attempts
+		FROM outbox
+		WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+		ORDER BY next_attempt_at ASC
+		LIMIT ?`, outboxBatchSize)
+	if err != nil {
+		logger.Error("polling outbox", slog.Any("error", err))
+		return
+	}
+
+	var batch []dueEmail
+	for rows.Next() {
+		var d dueEmail
+		if err := rows.Scan(&d.id, &d.to, &d.subject, &d.body, &d.attempts); err != nil {
+			logger.Error("scanning outbox row", slog.Any("error", err))
+			continue
+		}
+		batch = append(batch, d)
+	}
+	rows.Close()
+
+	for _, d := range batch {
+		sendOutboxEntry(db, transport, d)
+	}
+
+	updateQueueDepth(db)
+}
+
+func sendOutboxEntry(db *sql.DB, transport *mailer.Transport, d dueEmail) {
+	start := time.Now()
+	err := transport.Send(d.to, d.subject, d.body)
+	emailSendDuration.Observe(time.Since(start).Seconds())
+
+	attempts := d.attempts + 1
+
+	if err != nil {
+		emailFailedTotal.WithLabelValues("smtp_error").Inc()
+
+		if attempts >= maxSendAttempts {
+			if _, dbErr := db.Exec(`UPDATE outbox SET status = 'failed', attempts = ?, last_error = ? WHERE id = ?`,
+				attempts, err.Error(), d.id); dbErr != nil {
+				logger.Error("recording permanent send failure", slog.Any("error", dbErr))
+			}
+			logger.Error("email send permanently failed",
+				slog.Int64("outbox_id", d.id), slog.Int("attempts", attempts), slog.Any("error", err))
+			return
+		}
+
+		backoff := sendBackoff(attempts)
+		if _, dbErr := db.Exec(`UPDATE outbox SET attempts = ?, last_error = ?, next_attempt_at = datetime(CURRENT_TIMESTAMP, ?) WHERE id = ?`,
+			attempts, err.Error(), fmt.Sprintf("+%d seconds", int(backoff.Seconds())), d.id); dbErr != nil {
+			logger.Error("recording send retry", slog.Any("error", dbErr))
+		}
+		logger.Warn("email send failed, will retry",
+			slog.Int64("outbox_id", d.id), slog.Int("attempts", attempts), slog.Duration("backoff", backoff), slog.Any("error", err))
+		return
+	}
+
+	if _, dbErr := db.Exec(`UPDATE outbox SET status = 'sent', attempts = ?, sent_at = CURRENT_TIMESTAMP, last_error = '' WHERE id = ?`,
+		attempts, d.id); dbErr != nil {
+		logger.Error("recording send success", slog.Any("error", dbErr))
+		return
+	}
+	emailSentTotal.Inc()
+	logger.Info("email sent", slog.Int64("outbox_id", d.id), slog.Int("attempts", attempts))
+}
+
+// sendBackoff returns the delay before the next attempt, doubling each time
+// up to a 5 minute cap.
+func sendBackoff(attempts int) time.Duration {
+	const maxBackoff = 5 * time.Minute
+	backoff := time.Duration(1<<uint(attempts-1)) * time.Second
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+func updateQueueDepth(db *sql.DB) {
+	var depth int
+	if err := db.QueryRow(`SELECT count(*) FROM outbox WHERE status = 'pending'`).Scan(&depth); err != nil {
+		logger.Error("measuring outbox queue depth", slog.Any("error", err))
+		return
+	}
+	outboxQueueDepth.Set(float64(depth))
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	autocompleteLimit  = 10
+)
+
+type searchResult struct {
+	Name         string  `json:"name"`
+	NameSlug     string  `json:"name_slug"`
+	Email        string  `json:"email"`
+	Score        float64 `json:"score"`
+	NameSnippet  string  `json:"name_snippet"`
+	NotesSnippet string  `json:"notes_snippet"`
+}
+
+type searchResponse struct {
+	Results  []searchResult `json:"results"`
+	Warnings []string       `json:"warnings"`
+	Total    int            `json:"total"`
+}
+
+type autocompleteResult struct {
+	Name     string `json:"name"`
+	NameSlug string `json:"name_slug"`
+}
+
+type autocompleteResponse struct {
+	Results []autocompleteResult `json:"results"`
+}
+
+// searchHandler serves both GET /search?q=&limit=&offset= and POST /search
+// with a {"query": ..., "limit": ..., "offset": ...} body. It never 500s on
+// a malformed query: unsupported FTS5 operators are stripped and any
+// remaining parse failure surfaces as a warning alongside an empty result
+// set, modeled on Prometheus's API client pattern of returning warnings
+// alongside data for partial-success responses.
+func (s *foiaServer) searchHandler(w http.ResponseWriter, r *http.Request) {
+	var raw string
+	limit := defaultSearchLimit
+	offset := 0
+
+	switch r.Method {
+	case http.MethodPost:
+		var body struct {
+			Query  string `json:"query"`
+			Limit  int    `json:"limit"`
+			Offset int    `json:"offset"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, fmt.Sprintf("unable to decode body: %v", err), http.StatusBadRequest)
+			return
+		}
+		raw = body.Query
+		if body.Limit > 0 {
+			limit = body.Limit
+		}
+		offset = body.Offset
+	case http.MethodGet:
+		q := r.URL.Query()
+		raw = q.Get("q")
+		if v := q.Get("limit"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				limit = n
+			}
+		}
+		if v := q.Get("offset"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				offset = n
+			}
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if raw == "" {
+		http.Error(w, "Missing query", http.StatusBadRequest)
+		return
+	}
+
+	limit = clampSearchLimit(limit)
+	if offset < 0 {
+		offset = 0
+	}
+
+	ftsQuery, warnings := sanitizeSearchQuery(raw)
+	resp := searchResponse{Results: []searchResult{}, Warnings: warnings}
+
+	if ftsQuery == "" {
+		resp.Warnings = append(resp.Warnings, "query had no searchable terms after sanitization")
+		logger.Warn("search query had no searchable terms after sanitization",
+			slog.String("query", raw),
+			slog.String("request_id", requestIDFromContext(r.Context())),
+		)
+		writeJSON(w, resp)
+		return
+	}
+
+	if err := s.db.QueryRow(`SELECT count(*) FROM departments WHERE departments MATCH ?`, ftsQuery).Scan(&resp.Total); err != nil {
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf("unable to parse search query: %v", err))
+		logger.Warn("unable to parse search query",
+			slog.String("query", raw),
+			slog.Any("error", err),
+			slog.String("request_id", requestIDFromContext(r.Context())),
+		)
+		writeJSON(w, resp)
+		return
+	}
+
+	rows, err := s.db.Query(`
+		SELECT name,
+			name_slug,
+			email,
+			bm25(departments) as score,
+			snippet(departments, 0, '<mark>', '</mark>', '…', 16) as name_snippet,
+			snippet(departments, 4, '<mark>', '</mark>', '…', 16) as notes_snippet
+		FROM departments
+		WHERE departments MATCH ?
+		ORDER BY bm25(departments), name_slug
+		LIMIT ? OFFSET ?`, ftsQuery, limit, offset)
+	if err != nil {
+		resp.Warnings = append(resp.Warnings, fmt.Sprintf("unable to parse search query: %v", err))
+		logger.Warn("unable to parse search query",
+			slog.String("query", raw),
+			slog.Any("error", err),
+			slog.String("request_id", requestIDFromContext(r.Context())),
+		)
+		writeJSON(w, resp)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res searchResult
+		if err := rows.Scan(&res.Name, &res.NameSlug, &res.Email, &res.Score, &res.NameSnippet, &res.NotesSnippet); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, resp)
+}
+
+// autocompleteHandler backs a typeahead off the same prefix-matching logic
+// as searchHandler, returning just name/slug pairs.
+func (s *foiaServer) autocompleteHandler(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("q")
+	resp := autocompleteResponse{Results: []autocompleteResult{}}
+	if raw == "" {
+		writeJSON(w, resp)
+		return
+	}
+
+	ftsQuery, _ := sanitizeSearchQuery(raw)
+	if ftsQuery == "" {
+		writeJSON(w, resp)
+		return
+	}
+
+	rows, err := s.db.Query(`
+		SELECT name, name_slug
+		FROM departments
+		WHERE departments MATCH ?
+		ORDER BY bm25(departments), name_slug
+		LIMIT ?`, ftsQuery, autocompleteLimit)
+	if err != nil {
+		writeJSON(w, resp)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a autocompleteResult
+		if err := rows.Scan(&a.Name, &a.NameSlug); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Results = append(resp.Results, a)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, resp)
+}
+
+func clampSearchLimit(limit int) int {
+	if limit <= 0 {
+		return defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		return maxSearchLimit
+	}
+	return limit
+}
+
+// sanitizeSearchQuery rebuilds a user-supplied search string as a sequence
+// of quoted prefix tokens ("tok1"* "tok2"* ...), stripping any FTS5
+// operators or punctuation the user didn't intend rather than forwarding
+// them to MATCH, which would otherwise crash on unbalanced quotes or stray
+// operators.
+func sanitizeSearchQuery(raw string) (string, []string) {
+	var warnings []string
+	stripped := false
+
+	var tokens []string
+	for _, field := range strings.Fields(raw) {
+		clean := stripFTSOperators(field)
+		if clean == "" {
+			stripped = true
+			continue
+		}
+		if clean != field {
+			stripped = true
+		}
+		tokens = append(tokens, clean)
+	}
+	if stripped {
+		warnings = append(warnings, "query contained unsupported search operators or punctuation; they were ignored")
+	}
+
+	quoted := make([]string, len(tokens))
+	for i, t := range tokens {
+		quoted[i] = fmt.Sprintf("%q*", t)
+	}
+	return strings.Join(quoted, " "), warnings
+}
+
+func stripFTSOperators(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -10,16 +10,19 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 	"unicode"
 
 	"github.com/hhsnopek/etag"
+	"github.com/patrickod/sunshine/mailer"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	_ "modernc.org/sqlite"
@@ -28,9 +31,20 @@ import (
 )
 
 var (
-	port       = flag.Int("port", 8080, "http port to listen on")
-	runAsTSNet = flag.Bool("tsnet", false, "run as a Tailscale net server")
-	tsnetDir   = flag.String("tsnet-dir", "", "directory to store Tailscale state")
+	port         = flag.Int("port", 8080, "http port to listen on")
+	runAsTSNet   = flag.Bool("tsnet", false, "run as a Tailscale net server")
+	tsnetDir     = flag.String("tsnet-dir", "", "directory to store Tailscale state")
+	dbPath       = flag.String("db", "sunshine.db", "path to the sqlite database file")
+	logFormat    = flag.String("log-format", "text", "log output format: text or json")
+	logLevel     = flag.String("log-level", "info", "minimum log level: debug, info, warn, error")
+	adminUsers   = flag.String("admin-users", "", "comma-separated list of tailnet login names allowed to use admin endpoints")
+	adminTailnet = flag.String("admin-tailnet", "", "tailnet (login name domain) allowed to use admin endpoints")
+	devAllowAnon = flag.Bool("dev-allow-anon", false, "allow anonymous access to admin endpoints when not running under --tsnet (dev only)")
+	smtpHost     = flag.String("smtp-host", "", "SMTP server host for outbound FOIA request email (falls back to SUNSHINE_SMTP_HOST)")
+	smtpPort     = flag.Int("smtp-port", 587, "SMTP server port")
+	smtpUser     = flag.String("smtp-user", "", "SMTP username (falls back to SUNSHINE_SMTP_USER)")
+	smtpPass     = flag.String("smtp-pass", "", "SMTP password (falls back to SUNSHINE_SMTP_PASS)")
+	smtpFrom     = flag.String("smtp-from", "", "From address for outbound FOIA request email (falls back to SUNSHINE_SMTP_FROM)")
 	//go:embed static/*
 	staticFS embed.FS
 
@@ -114,27 +128,6 @@ type Department struct {
 	URL         string `json:"url"`
 }
 
-// LoggingMiddleware wraps an http.Handler and logs request summaries
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		// Call the next handler
-		next.ServeHTTP(w, r)
-
-		// Log the request summary
-		duration := time.Since(start)
-		log.Printf("%s - - [%s] \"%s %s %s\" %.3f\n",
-			r.RemoteAddr,
-			start.Format("02/Jan/2006:15:04:05 -0700"),
-			r.Method,
-			r.URL.Path,
-			r.Proto,
-			duration.Seconds(),
-		)
-	})
-}
-
 func loadDepartments() map[string]Department {
 	var d map[string]Department
 	f, err := staticFS.Open("static/departments.json")
@@ -147,46 +140,17 @@ func loadDepartments() map[string]Department {
 	return d
 }
 
-func createDB() *sql.DB {
-	db, err := sql.Open("sqlite3", ":memory:")
-	if err != nil {
-		log.Fatalf("unable to open database: %v", err)
-	}
-	_, err = db.Exec(`CREATE VIRTUAL TABLE departments USING FTS5(
-		name,
-		name_slug,
-		email,
-		contact_name,
-		notes,
-		url
-	)`)
-	if err != nil {
-		log.Fatalf("unable to create departments table: %v", err)
-	}
-
-	for name, dept := range *departments {
-		_, err := db.Exec(`INSERT INTO departments (
-			name,
-			name_slug,
-			email,
-			url
-		) VALUES (?, ?, ?, ?)`,
-			name,
-			slugify(name),
-			dept.Email,
-			dept.URL,
-		)
-		if err != nil {
-			log.Fatalf("unable to insert department: %v", err)
-		}
-	}
-
-	return db
-
-}
-
 type foiaServer struct {
 	db *sql.DB
+
+	// requireAdmin gates mutation endpoints behind the tailnet identity
+	// check installed by main(); see adminAuth.Middleware.
+	requireAdmin func(http.Handler) http.Handler
+
+	// requireIdentity gates endpoints that only need the caller's tailnet
+	// identity resolved, not admin allow-list membership; see
+	// adminAuth.RequireIdentity.
+	requireIdentity func(http.Handler) http.Handler
 }
 
 func (s *foiaServer) CreateMux() *http.ServeMux {
@@ -196,6 +160,12 @@ func (s *foiaServer) CreateMux() *http.ServeMux {
 	mux.HandleFunc("/email-template", s.emailTemplateHandler)
 	mux.HandleFunc("/department/{id}", s.departmentHandler)
 	mux.HandleFunc("/search", s.searchHandler)
+	mux.HandleFunc("/autocomplete", s.autocompleteHandler)
+	mux.Handle("POST /department/{id}/send", s.requireIdentity(http.HandlerFunc(s.sendDepartmentHandler)))
+	mux.Handle("GET /outbox/{id}", s.requireIdentity(http.HandlerFunc(s.outboxHandler)))
+	mux.Handle("POST /api/departments", s.requireAdmin(http.HandlerFunc(s.createDepartmentHandler)))
+	mux.Handle("PUT /api/departments/{id}", s.requireAdmin(http.HandlerFunc(s.updateDepartmentHandler)))
+	mux.Handle("DELETE /api/departments/{id}", s.requireAdmin(http.HandlerFunc(s.deleteDepartmentHandler)))
 	mux.Handle("/static/", http.FileServer(http.FS(staticFS)))
 	return mux
 }
@@ -211,17 +181,80 @@ func init() {
 func main() {
 	flag.Parse()
 
+	logger = newLogger(*logFormat, *logLevel)
+
 	// Load departments (you'll need to implement loadDepartments())
 	d := loadDepartments()
 	departments = &d
-	log.Printf("Loaded %d departments\n", len(*departments))
+	logger.Info("loaded departments", slog.Int("count", len(*departments)))
+
+	db, err := openDB(*dbPath)
+	if err != nil {
+		log.Fatalf("unable to open database: %v", err)
+	}
+	if err := seedDepartments(db, *departments); err != nil {
+		log.Fatalf("unable to seed departments: %v", err)
+	}
+
+	s := &foiaServer{db: db}
+
+	var tsnetServer *tsnet.Server
+	var metricsListener net.Listener
+	if *runAsTSNet {
+		if *tsnetDir == "" {
+			log.Fatalf("must specify --tsnet-dir with --tsnet")
+		}
+		var err error
+		tsnetServer = &tsnet.Server{
+			Hostname: "sunshine",
+			AuthKey:  os.Getenv("TS_AUTHKEY"),
+			Logf:     tsnetLogf(logger),
+			Dir:      *tsnetDir,
+		}
+		metricsListener, err = tsnetServer.Listen("tcp", ":80")
+		logger.Info("starting prometheus server", slog.String("addr", ":80"), slog.String("transport", "tsnet"))
+		if err != nil {
+			log.Fatalf("Failed to listen on port 80: %v", err)
+		}
+	} else {
+		var err error
+		logger.Info("starting prometheus server", slog.String("addr", "localhost:8081"))
+		metricsListener, err = net.Listen("tcp", "localhost:8081")
+		if err != nil {
+			log.Fatalf("Failed to listen on port 8081: %v", err)
+		}
+	}
 
-	s := &foiaServer{
-		db: createDB(),
+	var whoIs tsnetWhoIs
+	if tsnetServer != nil {
+		lc, err := tsnetServer.LocalClient()
+		if err != nil {
+			log.Fatalf("Failed to start tsnet: %v", err)
+		}
+		whoIs = lc
 	}
+	auth := newAdminAuth(whoIs, *adminUsers, *adminTailnet, *devAllowAnon)
+	s.requireAdmin = auth.Middleware
+	s.requireIdentity = auth.RequireIdentity
+
+	transport := mailer.NewTransport(mailer.Config{
+		Host: flagOrEnv(*smtpHost, "SUNSHINE_SMTP_HOST"),
+		Port: *smtpPort,
+		User: flagOrEnv(*smtpUser, "SUNSHINE_SMTP_USER"),
+		Pass: flagOrEnv(*smtpPass, "SUNSHINE_SMTP_PASS"),
+		From: flagOrEnv(*smtpFrom, "SUNSHINE_SMTP_FROM"),
+	})
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	var workerWG sync.WaitGroup
+	workerWG.Add(1)
+	go func() {
+		defer workerWG.Done()
+		runOutboxWorker(workerCtx, db, transport, 5*time.Second)
+	}()
 
 	// Wrap the mux with the dynamic label middleware
 	mux := s.CreateMux()
+	mux.HandleFunc("/whoami", whoamiHandler(auth))
 	// Create a dynamic label middleware
 	dynamicLabelMiddleware := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -242,7 +275,7 @@ func main() {
 		})
 	}
 	withPrometheus := dynamicLabelMiddleware(mux)
-	withLogging := LoggingMiddleware(withPrometheus)
+	withLogging := LoggingMiddleware(logger)(withPrometheus)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -257,37 +290,12 @@ func main() {
 	metricsMux := http.NewServeMux()
 	tsweb.Debugger(metricsMux)
 	promServer := &http.Server{
-		Handler: metricsMux,
+		Handler: auth.Middleware(metricsMux),
 	}
 
-	var metricsListener net.Listener
-	if *runAsTSNet {
-		if *tsnetDir == "" {
-			log.Fatalf("must specify --tsnet-dir with --tsnet")
-		}
-		var err error
-		s := tsnet.Server{
-			Hostname: "sunshine",
-			AuthKey:  os.Getenv("TS_AUTHKEY"),
-			Logf:     log.Printf,
-			Dir:      *tsnetDir,
-		}
-		metricsListener, err = s.Listen("tcp", ":80")
-		log.Println("Starting Prometheus server on port 80 tsnet")
-		if err != nil {
-			log.Fatalf("Failed to listen on port 80: %v", err)
-		}
-	} else {
-		var err error
-		log.Println("Starting Prometheus server on port 8081")
-		metricsListener, err = net.Listen("tcp", "localhost:8081")
-		if err != nil {
-			log.Fatalf("Failed to listen on port 8081: %v", err)
-		}
-	}
 	// Start main server
 	go func() {
-		log.Printf("Starting server on port %d\n", *port)
+		logger.Info("starting server", slog.Int("port", *port))
 		errChan <- mainServer.ListenAndServe()
 	}()
 
@@ -298,7 +306,7 @@ func main() {
 
 	// Wait for shutdown signal
 	<-ctx.Done()
-	log.Println("Shutting down servers...")
+	logger.Info("shutting down servers")
 
 	// Create a timeout context for shutdown
 	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
@@ -306,23 +314,44 @@ func main() {
 
 	// Shutdown both servers
 	if err := mainServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Main server shutdown error: %v\n", err)
+		logger.Error("main server shutdown error", slog.Any("error", err))
 	}
 	if err := promServer.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Prometheus server shutdown error: %v\n", err)
+		logger.Error("prometheus server shutdown error", slog.Any("error", err))
+	}
+
+	// Stop the outbox worker from starting new batches and let any in-flight
+	// send finish within the shutdown window.
+	stopWorker()
+	workerDone := make(chan struct{})
+	go func() {
+		workerWG.Wait()
+		close(workerDone)
+	}()
+	select {
+	case <-workerDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("outbox worker did not drain before shutdown timeout")
 	}
 
 	// Wait for server goroutines to exit
 	select {
 	case err := <-errChan:
 		if err != nil && err != http.ErrServerClosed {
-			log.Printf("Server error: %v\n", err)
+			logger.Error("server error", slog.Any("error", err))
 		}
 	case <-shutdownCtx.Done():
-		log.Println("Shutdown timeout")
+		logger.Warn("shutdown timeout")
 	}
 
-	log.Println("Servers successfully shut down")
+	logger.Info("servers successfully shut down")
+
+	// The dedup handler buffers records for up to a second; flush that final
+	// record now rather than let it be silently dropped when the process
+	// exits immediately below.
+	if dh, ok := logger.Handler().(*dedupHandler); ok {
+		dh.Close()
+	}
 }
 
 func (s *foiaServer) indexHandler(w http.ResponseWriter, r *http.Request) {
@@ -334,7 +363,7 @@ func (s *foiaServer) indexHandler(w http.ResponseWriter, r *http.Request) {
 			coalesce(contact_name, '') as contact_name,
 			coalesce(notes, '') as notes,
 			coalesce(url, '') as url
-		FROM departments
+		FROM departments_base
 		ORDER BY name ASC`)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -372,7 +401,7 @@ func (s *foiaServer) departmentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var department Department
-	row := s.db.QueryRow(`SELECT name, name_slug, email, coalesce(contact_name, '') as contact_name, coalesce(notes, '') as notes, coalesce(url, '') as url FROM departments WHERE name_slug = ?`, id)
+	row := s.db.QueryRow(`SELECT name, name_slug, email, coalesce(contact_name, '') as contact_name, coalesce(notes, '') as notes, coalesce(url, '') as url FROM departments_base WHERE name_slug = ?`, id)
 	if err := row.Scan(&department.Name, &department.NameSlug, &department.Email, &department.ContactName, &department.Notes, &department.URL); err != nil {
 		http.Error(w, fmt.Sprintf("Department not found: %v", err), http.StatusNotFound)
 		return
@@ -384,59 +413,37 @@ func (s *foiaServer) departmentHandler(w http.ResponseWriter, r *http.Request) {
 	}{department, "This is the email body"})
 }
 
-func (s *foiaServer) searchHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var query struct {
-		Query string `json:"query"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
-		http.Error(w, fmt.Sprintf("unable to decode body: %v", err.Error()), http.StatusBadRequest)
-		return
-	}
-
-	if query.Query == "" {
-		http.Error(w, "Missing query", http.StatusBadRequest)
-		return
-
-	}
-
-	rows, err := s.db.Query(`SELECT name, name_slug, email FROM departments WHERE departments MATCH ?`, query.Query)
+func (s *foiaServer) listHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.Query(`
+		SELECT name,
+			name_slug,
+			email,
+			coalesce(contact_name, '') as contact_name,
+			coalesce(notes, '') as notes,
+			coalesce(url, '') as url
+		FROM departments_base
+		ORDER BY name ASC`)
 	if err != nil {
-		http.Error(w, "Error querying department data", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 
-	type searchResult struct {
-		Name     string `json:"name"`
-		NameSlug string `json:"name_slug"`
-		Email    string `json:"email"`
-	}
-	results := make([]searchResult, 0)
-
+	result := make(map[string]Department)
 	for rows.Next() {
-		r := searchResult{}
-		if err := rows.Scan(&r.Name, &r.NameSlug, &r.Email); err != nil {
+		var d Department
+		if err := rows.Scan(&d.Name, &d.NameSlug, &d.Email, &d.ContactName, &d.Notes, &d.URL); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		results = append(results, r)
+		result[d.Name] = d
 	}
 	if err := rows.Err(); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
-}
-
-func (s *foiaServer) listHandler(w http.ResponseWriter, r *http.Request) {
-	safeRender(w, listTemplate, struct{ Departments map[string]Department }{loadDepartments()})
+	safeRender(w, listTemplate, struct{ Departments map[string]Department }{result})
 }
 
 func safeRender(w http.ResponseWriter, tmpl *template.Template, data interface{}) {
@@ -450,6 +457,15 @@ func safeRender(w http.ResponseWriter, tmpl *template.Template, data interface{}
 	w.Write(b.Bytes())
 }
 
+// flagOrEnv returns flagVal if set, otherwise the value of the named
+// environment variable.
+func flagOrEnv(flagVal, envKey string) string {
+	if flagVal != "" {
+		return flagVal
+	}
+	return os.Getenv(envKey)
+}
+
 // lowercase, no space, sub all non alphanum with dash
 func slugify(s string) string {
 	s = strings.ToLower(s)